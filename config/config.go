@@ -0,0 +1,81 @@
+// Package config loads flaresync's declarative multi-policy configuration:
+// a list of independent Cloud Armor policies to reconcile, each confined
+// to its own priority window so flaresync never touches rules a human
+// maintains elsewhere in the same policy.
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Target describes one reconciliation job: which project and policy to
+// target, which IP source feeds it, what action newly created rules
+// should take, and the inclusive priority range the reconciler is allowed
+// to touch.
+type Target struct {
+	Project         string `yaml:"project"`
+	Policy          string `yaml:"policy"`
+	Source          string `yaml:"source"`
+	Action          string `yaml:"action"`
+	PriorityStart   int32  `yaml:"priorityStart"`
+	PriorityEnd     int32  `yaml:"priorityEnd"`
+	RuleDescription string `yaml:"ruleDescription"`
+	DryRun          bool   `yaml:"dryRun"`
+}
+
+// Config is the top-level shape of a -config YAML file.
+type Config struct {
+	Targets []Target `yaml:"targets"`
+}
+
+var validActions = map[string]bool{
+	"allow":          true,
+	"deny":           true,
+	"rate_based_ban": true,
+	"throttle":       true,
+}
+
+// Load reads, parses and validates a Config from path, applying defaults
+// (source "cloudflare", action "allow", a rule description derived from
+// the source) to any target that omits them.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(cfg.Targets) == 0 {
+		return nil, fmt.Errorf("%s defines no targets", path)
+	}
+
+	for i := range cfg.Targets {
+		t := &cfg.Targets[i]
+		if t.Project == "" || t.Policy == "" {
+			return nil, fmt.Errorf("target %d: project and policy are required", i)
+		}
+		if t.Source == "" {
+			t.Source = "cloudflare"
+		}
+		if t.Action == "" {
+			t.Action = "allow"
+		}
+		if !validActions[t.Action] {
+			return nil, fmt.Errorf("target %d (%s/%s): unknown action %q", i, t.Project, t.Policy, t.Action)
+		}
+		if t.RuleDescription == "" {
+			t.RuleDescription = t.Source
+		}
+		if t.PriorityEnd <= t.PriorityStart {
+			return nil, fmt.Errorf("target %d (%s/%s): priorityEnd must be greater than priorityStart", i, t.Project, t.Policy)
+		}
+	}
+
+	return &cfg, nil
+}
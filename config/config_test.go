@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadYAML(t *testing.T, yaml string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatalf("writing test config: %v", err)
+	}
+	return Load(path)
+}
+
+func TestLoadAppliesDefaults(t *testing.T) {
+	cfg, err := loadYAML(t, `
+targets:
+  - project: my-project
+    policy: my-policy
+    priorityStart: 1000
+    priorityEnd: 2000
+`)
+	if err != nil {
+		t.Fatalf("Load returned an error: %v", err)
+	}
+	target := cfg.Targets[0]
+	if target.Source != "cloudflare" {
+		t.Errorf("Source = %q, want %q", target.Source, "cloudflare")
+	}
+	if target.Action != "allow" {
+		t.Errorf("Action = %q, want %q", target.Action, "allow")
+	}
+	if target.RuleDescription != "cloudflare" {
+		t.Errorf("RuleDescription = %q, want %q", target.RuleDescription, "cloudflare")
+	}
+}
+
+func TestLoadNoTargets(t *testing.T) {
+	if _, err := loadYAML(t, `targets: []`); err == nil {
+		t.Fatal("expected an error for a config with no targets, got nil")
+	}
+}
+
+func TestLoadMissingProjectOrPolicy(t *testing.T) {
+	if _, err := loadYAML(t, `
+targets:
+  - policy: my-policy
+    priorityStart: 1000
+    priorityEnd: 2000
+`); err == nil {
+		t.Fatal("expected an error for a target missing project, got nil")
+	}
+}
+
+func TestLoadUnknownAction(t *testing.T) {
+	if _, err := loadYAML(t, `
+targets:
+  - project: my-project
+    policy: my-policy
+    action: block
+    priorityStart: 1000
+    priorityEnd: 2000
+`); err == nil {
+		t.Fatal("expected an error for an unknown action, got nil")
+	}
+}
+
+func TestLoadInvalidPriorityWindow(t *testing.T) {
+	if _, err := loadYAML(t, `
+targets:
+  - project: my-project
+    policy: my-policy
+    priorityStart: 2000
+    priorityEnd: 1000
+`); err == nil {
+		t.Fatal("expected an error for priorityEnd <= priorityStart, got nil")
+	}
+}
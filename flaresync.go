@@ -1,28 +1,79 @@
 package main
 
 import (
-	"cloudflareparser"
+	"config"
 	"context"
 	"flag"
 	"fmt"
 	"gcp"
+	"ipsource"
+	"leader"
+	"net/http"
 	"os"
-	"reflect"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	compute "cloud.google.com/go/compute/apiv1"
 	computepb "cloud.google.com/go/compute/apiv1/computepb"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"cloud.google.com/go/storage"
 	"github.com/coralogix/go-coralogix-sdk"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"metrics"
+)
+
+// stringSliceFlag collects every value passed to a repeatable flag, e.g.
+// -source cloudflare -source aws.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string { return strings.Join(*s, ",") }
+func (s *stringSliceFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// defaultPriorityStart/End are the priority window assigned to targets
+// synthesized from the legacy -project/-policy/-source flags, which have
+// no way to express a window of their own. They're wide enough for any
+// realistic CIDR count while leaving room below for rules a human already
+// manages in the low priorities.
+const (
+	defaultPriorityStart = 1000
+	defaultPriorityEnd   = 2000000000
 )
 
 var (
 	// Command line flags
 	gcpProject string
 	gcpPolicy  string
+	configPath string
+	dryRun     bool
 	debug      bool
+	daemonMode bool
+	interval   time.Duration
+	// IP source selection (legacy -project/-policy mode only)
+	sourceNames       stringSliceFlag
+	awsService        string
+	awsRegion         string
+	gcpRangesURL      string
+	fileSourcePath    string
+	urlSourceURL      string
+	urlSourceV4Path   string
+	urlSourceV6Path   string
+	urlSourceETagPath string
+	// Metrics/probe server
+	metricsAddr string
+	// Leader election
+	leaderElection bool
+	leaseBucket    string
+	leaseObject    string
+	leaseTTL       time.Duration
 	// Coralogix creds
 	coralogix_app_name       string = os.Getenv("CORALOGIX_APP_NAME")
 	coralogix_key_gsm_name   string = os.Getenv("CORALOGIX_KEY_GSM_NAME")
@@ -32,12 +83,30 @@ var (
 )
 
 func init() {
-	flag.StringVar(&gcpProject, "project", "", "Google Cloud Project")
-	flag.StringVar(&gcpPolicy, "policy", "", "Cloud Armor policy name")
+	flag.StringVar(&gcpProject, "project", "", "Google Cloud Project (legacy single-policy mode; ignored with -config)")
+	flag.StringVar(&gcpPolicy, "policy", "", "Cloud Armor policy name (legacy single-policy mode; ignored with -config)")
+	flag.StringVar(&configPath, "config", "", "Path to a YAML file describing multiple reconciliation targets; overrides -project/-policy/-source")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the planned diff for every target without calling any mutating GCP API (legacy mode; a target's own dryRun takes precedence in -config mode)")
 	flag.BoolVar(&debug, "debug", false, "Add additional debugging output")
+	flag.BoolVar(&daemonMode, "daemon", false, "Keep running and re-sync on a ticker instead of exiting after one pass")
+	flag.DurationVar(&interval, "interval", 5*time.Minute, "Reconciliation interval when running with -daemon")
+	flag.Var(&sourceNames, "source", "IP source to reconcile: cloudflare|aws|gcp|fastly|file|url (repeatable; defaults to cloudflare)")
+	flag.StringVar(&awsService, "aws-service", "", "Filter the aws source to a single AWS service (e.g. CLOUDFRONT); empty matches all")
+	flag.StringVar(&awsRegion, "aws-region", "", "Filter the aws source to a single AWS region; empty matches all")
+	flag.StringVar(&gcpRangesURL, "gcp-ranges-url", ipsource.DefaultGCPRangesURL, "URL to fetch for the gcp source (cloud.json or goog.json)")
+	flag.StringVar(&fileSourcePath, "file", "", "Path to a local CIDR list (required with -source file)")
+	flag.StringVar(&urlSourceURL, "url", "", "URL to fetch for the url source (required with -source url)")
+	flag.StringVar(&urlSourceV4Path, "url-v4-path", "", "Dotted JSON path to the IPv4 CIDR list in the url source response (e.g. prefixes.[].ip_prefix); leave empty for a plain-text, one-CIDR-per-line response")
+	flag.StringVar(&urlSourceV6Path, "url-v6-path", "", "Dotted JSON path to the IPv6 CIDR list in the url source response")
+	flag.StringVar(&urlSourceETagPath, "url-etag-path", "", "Dotted JSON path to a version/etag field in the url source response; falls back to a hash of the response body")
+	flag.StringVar(&metricsAddr, "metrics-addr", ":9090", "Address to serve /metrics, /healthz and /readyz on in -daemon mode")
+	flag.BoolVar(&leaderElection, "leader-election", false, "Require a GCS lease to be held before mutating the policy (for multi-instance -daemon deployments)")
+	flag.StringVar(&leaseBucket, "lease-bucket", "", "GCS bucket holding the leader election lease object (required with -leader-election)")
+	flag.StringVar(&leaseObject, "lease-object", "flaresync-leader", "GCS object name used as the leader election lease")
+	flag.DurationVar(&leaseTTL, "lease-ttl", 30*time.Second, "How long a leader election lease stays valid before another instance may take over")
 }
 
-// Show usage options if no project/policy specified
+// Show usage options if no project/policy/config specified
 func customHelp() {
 	fmt.Println("Usage: flaresync [OPTIONS]")
 	fmt.Println("Options:")
@@ -45,6 +114,102 @@ func customHelp() {
 	fmt.Println()
 }
 
+// providerFor builds the ipsource.Provider for a single source name, using
+// whichever provider-specific flags (-aws-service, -file, -url, ...) were
+// given on the command line. It is shared by every target regardless of
+// whether that target came from -config or the legacy flags, since
+// provider-specific options aren't (yet) expressible per-target in the
+// config file.
+func providerFor(name string) (ipsource.Provider, error) {
+	switch name {
+	case "cloudflare":
+		return ipsource.NewCloudflareProvider(), nil
+	case "aws":
+		return ipsource.NewAWSProvider(awsService, awsRegion), nil
+	case "gcp":
+		return ipsource.NewGCPProvider(gcpRangesURL), nil
+	case "fastly":
+		return ipsource.NewFastlyProvider(), nil
+	case "file":
+		if fileSourcePath == "" {
+			return nil, fmt.Errorf("-source file requires -file")
+		}
+		return ipsource.NewFileProvider(fileSourcePath), nil
+	case "url":
+		if urlSourceURL == "" {
+			return nil, fmt.Errorf("-source url requires -url")
+		}
+		return ipsource.NewGenericProvider(urlSourceURL, urlSourceV4Path, urlSourceV6Path, urlSourceETagPath), nil
+	default:
+		return nil, fmt.Errorf("unknown source %q", name)
+	}
+}
+
+// legacyTargets synthesizes one config.Target per -source flag (defaulting
+// to cloudflare alone) out of the -project/-policy/-dry-run flags, so the
+// pre-config single-policy CLI keeps working unchanged and is reconciled
+// through the exact same machinery as a -config file. Each target gets its
+// own slice of the default priority window (rather than all of them sharing
+// [defaultPriorityStart, defaultPriorityEnd]) so two legacy sources
+// reconciling the same policy never have their new rules collide on the
+// same priority.
+func legacyTargets() []config.Target {
+	names := []string(sourceNames)
+	if len(names) == 0 {
+		names = []string{"cloudflare"}
+	}
+
+	total := gcp.Window{Start: defaultPriorityStart, End: defaultPriorityEnd}
+	slice := total.Size() / int32(len(names))
+
+	targets := make([]config.Target, 0, len(names))
+	for i, name := range names {
+		start := defaultPriorityStart + int32(i)*slice
+		end := start + slice - 1
+		if i == len(names)-1 {
+			// give the last slice any remainder from the integer division
+			end = defaultPriorityEnd
+		}
+		targets = append(targets, config.Target{
+			Project:         gcpProject,
+			Policy:          gcpPolicy,
+			Source:          name,
+			Action:          "allow",
+			PriorityStart:   start,
+			PriorityEnd:     end,
+			RuleDescription: name,
+			DryRun:          dryRun,
+		})
+	}
+	return targets
+}
+
+// policyGroup is every target that reconciles the same Cloud Armor policy,
+// so they can share a single combined-ETag Description and a single
+// GetCloudArmorPolicy/PatchCloudArmorPolicy round trip.
+type policyGroup struct {
+	Project string
+	Policy  string
+	Targets []config.Target
+}
+
+// groupTargets groups targets by (Project, Policy), preserving the order
+// in which each policy was first seen.
+func groupTargets(targets []config.Target) []policyGroup {
+	var groups []policyGroup
+	index := make(map[string]int)
+	for _, t := range targets {
+		key := t.Project + "/" + t.Policy
+		if i, ok := index[key]; ok {
+			groups[i].Targets = append(groups[i].Targets, t)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, policyGroup{Project: t.Project, Policy: t.Policy, Targets: []config.Target{t}})
+	}
+	return groups
+}
+
 func main() {
 	// Initialize exit routine (this allows the app to finish all deferred functions)
 	var exitCode int
@@ -52,11 +217,46 @@ func main() {
 
 	// Check the cmd line args
 	flag.Parse()
-	if (gcpProject == "") || (gcpPolicy == "") {
-		customHelp()
-		exitCode = 1
-		return
+
+	var targets []config.Target
+	if configPath != "" {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			fmt.Println(err)
+			exitCode = 1
+			return
+		}
+		targets = cfg.Targets
+	} else {
+		if (gcpProject == "") || (gcpPolicy == "") {
+			customHelp()
+			exitCode = 1
+			return
+		}
+		targets = legacyTargets()
+	}
+
+	// fail fast on an unknown source or a missing provider-specific flag,
+	// before any network call or GCP client is created. While we're here,
+	// fill in any target whose RuleDescription is still its bare source
+	// name with the provider's own Name() (e.g. a url source becomes
+	// "url:https://..." instead of just "url"). Provider options come from
+	// the global flags, so two targets with the same source and no explicit
+	// ruleDescription still share one rule namespace.
+	for i := range targets {
+		t := &targets[i]
+		provider, err := providerFor(t.Source)
+		if err != nil {
+			fmt.Println(err)
+			customHelp()
+			exitCode = 1
+			return
+		}
+		if t.RuleDescription == t.Source {
+			t.RuleDescription = provider.Name()
+		}
 	}
+	groups := groupTargets(targets)
 
 	// Debug
 	if debug {
@@ -116,327 +316,421 @@ func main() {
 		defer CoralogixHook.Close()
 	}
 
-	log.WithFields(log.Fields{
-		"timestamp":     time.Now(),
-		"unixtimestamp": time.Now().UnixNano(),
-		"project":       gcpProject,
-	}).Infof("Starting flaresync for policy: %v", gcpPolicy)
-
-	// get the actual ETag and ranges from CF:
-	cf_etag, cf_networks, err := cloudflareparser.ParseCloudflareJSON()
+	// prepare SecurityPolicies GCP client
+	client, err := compute.NewSecurityPoliciesRESTClient(ctx)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"timestamp":     time.Now(),
 			"unixtimestamp": time.Now().UnixNano(),
 			"project":       gcpProject,
-		}).Errorf("Error getting CloudFlare networks and/or ETag: %v", err)
+		}).Errorf("Failed to create Compute Engine client: %v", err)
 		exitCode = 1
 		return
 	}
-	cf_networks_len := len(cf_networks) // we'll use this var later several times
-	log.WithFields(log.Fields{
-		"timestamp":     time.Now(),
-		"unixtimestamp": time.Now().UnixNano(),
-		"project":       gcpProject,
-	}).Info("CF ETag is: ", cf_etag)
-	for _, val := range cf_networks { // just for debugging purposes
+	defer client.Close()
+
+	if !daemonMode {
+		metrics.CurrentSourceEtag.Reset()
+		for _, group := range groups {
+			if err := runSyncForPolicy(ctx, client, group); err != nil {
+				exitCode = 1
+			}
+		}
+		return
+	}
+
+	if err := runDaemon(ctx, client, groups); err != nil {
 		log.WithFields(log.Fields{
 			"timestamp":     time.Now(),
 			"unixtimestamp": time.Now().UnixNano(),
 			"project":       gcpProject,
-		}).Debug(val)
+		}).Errorf("Daemon exited with an error: %v", err)
+		exitCode = 1
 	}
+}
 
-	// prepare SecurityPolicies GCP client
-	client, err := compute.NewSecurityPoliciesRESTClient(ctx)
-	if err != nil {
+// runDaemon keeps flaresync alive, re-running runSyncForPolicy for every
+// configured policy group on a ticker until ctx is cancelled (by a
+// SIGTERM/SIGINT, handled below). It serves /metrics, /healthz and /readyz
+// for the lifetime of the process, and, if -leader-election is set, only
+// lets the current leader perform mutations so multiple replicas can run
+// safely side by side.
+func runDaemon(ctx context.Context, client *compute.SecurityPoliciesClient, groups []policyGroup) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var elector leader.Elector
+	if leaderElection {
+		storageClient, err := storage.NewClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create GCS client for leader election: %w", err)
+		}
+		defer storageClient.Close()
+
+		hostname, _ := os.Hostname()
+		holderID := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		elector = leader.NewGCSElector(storageClient, leaseBucket, leaseObject, holderID, leaseTTL)
+	}
+
+	var ready atomic.Bool
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if ready.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	metricsServer := &http.Server{Addr: metricsAddr, Handler: mux}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithFields(log.Fields{
+				"timestamp":     time.Now(),
+				"unixtimestamp": time.Now().UnixNano(),
+				"project":       gcpProject,
+			}).Errorf("Metrics server stopped: %v", err)
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		metricsServer.Shutdown(shutdownCtx)
+	}()
+
+	tick := func() {
+		if elector != nil {
+			isLeader, err := elector.Campaign(ctx)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"timestamp":     time.Now(),
+					"unixtimestamp": time.Now().UnixNano(),
+					"project":       gcpProject,
+				}).Errorf("Leader election campaign failed: %v", err)
+				ready.Store(false)
+				return
+			}
+			if !isLeader {
+				log.WithFields(log.Fields{
+					"timestamp":     time.Now(),
+					"unixtimestamp": time.Now().UnixNano(),
+					"project":       gcpProject,
+				}).Debug("Not the leader, skipping this tick")
+				ready.Store(true)
+				return
+			}
+		}
+
+		start := time.Now()
+		metrics.CurrentSourceEtag.Reset()
+		var tickErr error
+		for _, group := range groups {
+			if err := runSyncForPolicy(ctx, client, group); err != nil {
+				tickErr = err
+			}
+		}
+		metrics.SyncDuration.Observe(time.Since(start).Seconds())
+		ready.Store(tickErr == nil)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	tick()
+	for {
+		select {
+		case <-ctx.Done():
+			log.WithFields(log.Fields{
+				"timestamp":     time.Now(),
+				"unixtimestamp": time.Now().UnixNano(),
+				"project":       gcpProject,
+			}).Info("Received shutdown signal, stopping flaresync daemon")
+			return nil
+		case <-ticker.C:
+			tick()
+		}
+	}
+}
+
+// gcpAction maps a config.Target's action name to the action string Cloud
+// Armor expects on a SecurityPolicyRule.
+func gcpAction(action string) string {
+	switch action {
+	case "deny":
+		return "deny(403)"
+	case "rate_based_ban":
+		return "rate_based_ban"
+	case "throttle":
+		return "throttle"
+	default:
+		return "allow"
+	}
+}
+
+// targetRanges is a single target's fetched snapshot: its provider's ETag
+// and the IPv4/IPv6 CIDRs it published.
+type targetRanges struct {
+	target config.Target
+	etag   string
+	v4     []string
+	v6     []string
+}
+
+// combineEtags builds a single deterministic string out of every target's
+// ETag (keyed by RuleDescription, sorted), suitable for storing in the
+// policy's Description so a later pass can tell whether anything changed
+// across the whole group of targets.
+func combineEtags(ranges []targetRanges) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		parts = append(parts, r.target.RuleDescription+"="+r.etag)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
+
+// runSyncForPolicy performs a single reconciliation pass over every target
+// that shares group.Project/group.Policy: it fetches each target's
+// provider, compares the non-dry-run targets' combined ETag against the
+// policy's Description, and, if anything changed, confines each target's
+// add/patch/remove operations to that target's own priority window so
+// targets never touch rules another target (or a human) manages in the
+// same policy.
+func runSyncForPolicy(ctx context.Context, client *compute.SecurityPoliciesClient, group policyGroup) error {
+	log.WithFields(log.Fields{
+		"timestamp":     time.Now(),
+		"unixtimestamp": time.Now().UnixNano(),
+		"project":       group.Project,
+	}).Infof("Starting flaresync for policy: %v", group.Policy)
+
+	// fetch every target's ranges up front, so a single fetch failure
+	// aborts the whole pass before any rules are touched
+	var ranges []targetRanges
+	for _, target := range group.Targets {
+		provider, err := providerFor(target.Source)
+		if err != nil {
+			return err
+		}
+		etag, v4, v6, fetchErr := provider.Fetch(ctx)
+		if fetchErr != nil {
+			metrics.FetchErrors.WithLabelValues(target.Source).Inc()
+			log.WithFields(log.Fields{
+				"timestamp":     time.Now(),
+				"unixtimestamp": time.Now().UnixNano(),
+				"project":       group.Project,
+			}).Errorf("Error fetching IP ranges from %s: %v", target.Source, fetchErr)
+			return fetchErr
+		}
 		log.WithFields(log.Fields{
 			"timestamp":     time.Now(),
 			"unixtimestamp": time.Now().UnixNano(),
-			"project":       gcpProject,
-		}).Errorf("Failed to create Compute Engine client: %v", err)
-		exitCode = 1
-		return
+			"project":       group.Project,
+		}).Infof("%s ETag is: %v", target.RuleDescription, etag)
+		for _, val := range append(append([]string{}, v4...), v6...) { // just for debugging purposes
+			log.WithFields(log.Fields{
+				"timestamp":     time.Now(),
+				"unixtimestamp": time.Now().UnixNano(),
+				"project":       group.Project,
+			}).Debug(val)
+		}
+		ranges = append(ranges, targetRanges{target: target, etag: etag, v4: v4, v6: v6})
 	}
-	defer client.Close()
+
+	// dry-run targets never update the policy's combined-ETag Description,
+	// so they're never falsely reported as synced
+	var mutating []targetRanges
+	for _, r := range ranges {
+		if !r.target.DryRun {
+			mutating = append(mutating, r)
+		}
+	}
+	combinedEtag := combineEtags(mutating)
 
 	// get the policy
-	policy, err := gcp.GetCloudArmorPolicy(ctx, client, gcpProject, gcpPolicy)
+	policy, err := gcp.GetCloudArmorPolicy(ctx, client, group.Project, group.Policy)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"timestamp":     time.Now(),
 			"unixtimestamp": time.Now().UnixNano(),
-			"project":       gcpProject,
+			"project":       group.Project,
 		}).Errorf("Failed to get the security policy state: %v", err)
-		exitCode = 1
-		return
+		return err
 	}
 
-	// get etag and description for the current GCP policy
-	ca_etag, ca_description := policy.GetFingerprint(), policy.GetDescription()
 	log.WithFields(log.Fields{
 		"timestamp":     time.Now(),
 		"unixtimestamp": time.Now().UnixNano(),
-		"project":       gcpProject,
-	}).Infof("Found this CF ETag on GCP policy: %v", ca_description)
+		"project":       group.Project,
+	}).Infof("Found this combined ETag on GCP policy: %v", policy.GetDescription())
 
-	// if the description i.e ca_etag on gcp policy and cf_etag are equal - exit without errors
-	if ca_description == cf_etag {
+	// if there's at least one mutating target and its combined ETag already
+	// matches the policy - exit without errors
+	if len(mutating) > 0 && policy.GetDescription() == combinedEtag {
 		log.WithFields(log.Fields{
 			"timestamp":     time.Now(),
 			"unixtimestamp": time.Now().UnixNano(),
-			"project":       gcpProject,
-		}).Info("The policy and CloudFlare have the same ETags, exiting")
-		exitCode = 0
-		return
-	}
-
-	// if the policy description and cf_etag are different - update the policy
-
-	// prepare variables
-	// default settings for policy rules
-	rule_description := "cloudflare - dont change"
-	action := "allow"
-	ver := "SRC_IPS_V1"
-	// get the number of CF rules in the current GCP policy
-	policy_rules_number := 0
-	for _, v := range policy.Rules {
-		if v.Description != nil && *v.Description == rule_description {
-			policy_rules_number++
-		}
+			"project":       group.Project,
+		}).Info("The policy and all sources have the same ETags, exiting")
+		return nil
 	}
-	log.WithFields(log.Fields{
-		"timestamp":     time.Now(),
-		"unixtimestamp": time.Now().UnixNano(),
-		"project":       gcpProject,
-	}).Debug("Found ", policy_rules_number, " CF rules in the current policy")
 
-	// calculcate the number of rules we need to store CF networks (GCP limit is 10 networks per rule)
-	rulesNeeded := (cf_networks_len + 9) / 10
-	log.WithFields(log.Fields{
-		"timestamp":     time.Now(),
-		"unixtimestamp": time.Now().UnixNano(),
-		"project":       gcpProject,
-	}).Debug("We need ", rulesNeeded, "for CF networks")
+	// reconcile each target's v4/v6 ranges independently, confined to its
+	// own priority window: GCP requires v4 and v6 ranges to live in
+	// separate SRC_IPS_V1 rules, and every target owns its own rule
+	// description namespace and priority range so targets never clobber
+	// each other's rules or a human's
+	for _, r := range ranges {
+		target := r.target
+		v4Description := target.RuleDescription + "-v4 - dont change"
+		v6Description := target.RuleDescription + "-v6 - dont change"
 
-	// decide which list or rules is bigger and assign rulesCounter to it for later iteration
-	// rulesCounter := max(policy_rules_number, cf_networks_len)
-	rulesCounter := max(policy_rules_number, rulesNeeded)
-	log.WithFields(log.Fields{
-		"timestamp":     time.Now(),
-		"unixtimestamp": time.Now().UnixNano(),
-		"project":       gcpProject,
-	}).Debug("The rules counter is set to: ", rulesCounter)
-	// set left and right pointers to indexes in the CF networks slice
-	l, r := 0, 0
-	// Case 1: there are now rules in the policy yet
-	if policy_rules_number == 0 {
-		// iterate over the previously calculated number of required rules
-		for i := 0; i < rulesNeeded; i++ {
-			var prio int32 = int32(i)
-			// calculate the right index pointer: move 10 positions to the right or to the end of the network slice
-			r = l + 10
-			if r > cf_networks_len {
-				r = cf_networks_len
-			}
+		window := gcp.Window{Start: target.PriorityStart, End: target.PriorityEnd}
+		// SplitStable, not Split: once either family has rules deployed,
+		// the v4/v6 boundary is pinned to where they already live, so a
+		// CIDR-count change in one family on a later pass can't shift the
+		// other family's existing rules to a new, possibly-occupied
+		// priority.
+		v4Window, v6Window, err := window.SplitStable(policy, v4Description, v6Description, len(r.v4), len(r.v6))
+		if err != nil {
 			log.WithFields(log.Fields{
 				"timestamp":     time.Now(),
 				"unixtimestamp": time.Now().UnixNano(),
-				"project":       gcpProject,
-			}).Debug("l and r values are: ", l, r)
-			// form a rule
-			rule := &computepb.SecurityPolicyRule{
-				Description: &rule_description,
-				Action:      &action,
-				Priority:    &prio,
-				Match: &computepb.SecurityPolicyRuleMatcher{
-					VersionedExpr: &ver,
-					Config: &computepb.SecurityPolicyRuleMatcherConfig{
-						// use r and l pointers to copy CF networks to the rule
-						SrcIpRanges: cf_networks[l:r],
-					},
+				"project":       group.Project,
+			}).Errorf("Failed to allocate a priority window for %s: %v", target.RuleDescription, err)
+			return err
+		}
+
+		action := gcpAction(target.Action)
+		families := []struct {
+			name     string
+			networks []string
+			opts     gcp.PlanOptions
+		}{
+			{
+				name:     target.RuleDescription + "-v4",
+				networks: r.v4,
+				opts: gcp.PlanOptions{
+					RuleDescription: v4Description,
+					Action:          action,
+					VersionedExpr:   "SRC_IPS_V1",
+					PriorityStart:   v4Window.Start,
+					PriorityEnd:     v4Window.End,
+				},
+			},
+			{
+				name:     target.RuleDescription + "-v6",
+				networks: r.v6,
+				opts: gcp.PlanOptions{
+					RuleDescription: v6Description,
+					Action:          action,
+					VersionedExpr:   "SRC_IPS_V1",
+					PriorityStart:   v6Window.Start,
+					PriorityEnd:     v6Window.End,
 				},
+			},
+		}
+
+		for _, family := range families {
+			if len(family.networks) == 0 {
+				continue
 			}
-			// push the rule to the policy
-			log.WithFields(log.Fields{
-				"timestamp":     time.Now(),
-				"unixtimestamp": time.Now().UnixNano(),
-				"project":       gcpProject,
-			}).Info("Adding new rules, batch number: ", i)
-			err = gcp.AddCloudArmorRule(ctx, client, gcpProject, gcpPolicy, rule)
+			// compute a diff/patch plan between the rules already in the
+			// policy and the desired networks, so we only touch rules
+			// whose effective CIDR set actually changed
+			plan, err := gcp.PlanPolicyDiff(policy, family.networks, family.opts)
 			if err != nil {
 				log.WithFields(log.Fields{
 					"timestamp":     time.Now(),
 					"unixtimestamp": time.Now().UnixNano(),
-					"project":       gcpProject,
-				}).Errorf("Failed to populate the policy with new rules: %v", err)
-				exitCode = 1
-				return
+					"project":       group.Project,
+				}).Errorf("Failed to compute the %s policy diff plan: %v", family.name, err)
+				return err
 			}
-			// move the left index pointer 10 positions to the right
-			l = +10
-		}
-	} else {
-		// Case 2: we already have rules in the policy and we want replace them with new ones
-		for i := 0; i < rulesCounter; i++ {
-			var prio int32 = int32(i)
-			// Subcase: GCP policy already has a rule of a given priority - patch it
-			if (i < rulesNeeded) && (i < policy_rules_number) {
-				log.WithFields(log.Fields{
-					"timestamp":     time.Now(),
-					"unixtimestamp": time.Now().UnixNano(),
-					"project":       gcpProject,
-				}).Info("Patching rule number: ", prio)
-				r = l + 10
-				if r > cf_networks_len {
-					r = cf_networks_len
-				}
-				log.WithFields(log.Fields{
-					"timestamp":     time.Now(),
-					"unixtimestamp": time.Now().UnixNano(),
-					"project":       gcpProject,
-				}).Debug("l and r values are: ", l, r)
-				// compare CF network list with already present rule
-				// use new right index pointer (left is always 0 for comparison with the current rule)
-				r2 := 0
-				if r == 10 {
-					r2 = 10
-				} else {
-					r2 = r % 10
-				}
-				// easy compare with reflect.DeepEqual function
-				// first condition to check: r and r2 (number of IP ranges in rules) must be equal, otherwise continue with rule update
-				if (r == r2) && (reflect.DeepEqual(cf_networks[l:r], policy.Rules[i].Match.Config.SrcIpRanges[0:r2])) {
-					log.WithFields(log.Fields{
-						"timestamp":     time.Now(),
-						"unixtimestamp": time.Now().UnixNano(),
-						"project":       gcpProject,
-					}).Info("... not patching, rules are the same")
-					// move the left index pointer 10 positions to the right
-					l = +10
-					continue
-				}
-				rule := &computepb.SecurityPolicyRule{
-					Description: &rule_description,
-					Action:      &action,
-					Priority:    &prio,
-					Match: &computepb.SecurityPolicyRuleMatcher{
-						VersionedExpr: &ver,
-						Config: &computepb.SecurityPolicyRuleMatcherConfig{
-							// use r and l pointers to copy CF networks to the rule
-							SrcIpRanges: cf_networks[l:r],
-						},
-					},
-				}
-				err = gcp.PatchCloudArmorRule(ctx, client, gcpProject, gcpPolicy, prio, rule)
-				if err != nil {
-					log.WithFields(log.Fields{
-						"timestamp":     time.Now(),
-						"unixtimestamp": time.Now().UnixNano(),
-						"project":       gcpProject,
-					}).Errorf("Failed to patch the policy rule: %v", err)
-					exitCode = 1
-					return
-				}
-				// Subcase: GCP policy has less rules than CF list - add new rules
-			} else if (i < rulesNeeded) && (i >= policy_rules_number) {
-				log.WithFields(log.Fields{
-					"timestamp":     time.Now(),
-					"unixtimestamp": time.Now().UnixNano(),
-					"project":       gcpProject,
-				}).Info("Adding new rule number: ", prio)
-				r = l + 10
-				if r > cf_networks_len {
-					r = cf_networks_len
-				}
+			log.WithFields(log.Fields{
+				"timestamp":     time.Now(),
+				"unixtimestamp": time.Now().UnixNano(),
+				"project":       group.Project,
+			}).Infof("%s plan: %d to add, %d to patch, %d to remove", family.name, len(plan.ToAdd), len(plan.ToPatch), len(plan.ToRemove))
+
+			if target.DryRun {
 				log.WithFields(log.Fields{
 					"timestamp":     time.Now(),
 					"unixtimestamp": time.Now().UnixNano(),
-					"project":       gcpProject,
-				}).Debug("l and r values are: ", l, r)
-				rule := &computepb.SecurityPolicyRule{
-					Description: &rule_description,
-					Action:      &action,
-					Priority:    &prio,
-					Match: &computepb.SecurityPolicyRuleMatcher{
-						VersionedExpr: &ver,
-						Config: &computepb.SecurityPolicyRuleMatcherConfig{
-							// use r and l pointers to copy CF networks to the rule
-							SrcIpRanges: cf_networks[l:r],
-						},
-					},
-				}
-				err = gcp.AddCloudArmorRule(ctx, client, gcpProject, gcpPolicy, rule)
-				if err != nil {
-					log.WithFields(log.Fields{
-						"timestamp":     time.Now(),
-						"unixtimestamp": time.Now().UnixNano(),
-						"project":       gcpProject,
-					}).Errorf("Failed to add a new rule to the policy: %v", err)
-					exitCode = 1
-					return
-				}
-				// Subcase: GCP policy has excessive rules - delete them
-			} else {
+					"project":       group.Project,
+				}).Infof("Dry run: not applying the %s plan", family.name)
+				continue
+			}
+
+			if err := gcp.ApplyPlan(ctx, client, group.Project, group.Policy, plan); err != nil {
 				log.WithFields(log.Fields{
 					"timestamp":     time.Now(),
 					"unixtimestamp": time.Now().UnixNano(),
-					"project":       gcpProject,
-				}).Info("Removing rule number: ", prio)
-				err = gcp.RemoveCloudArmorRule(ctx, client, gcpProject, gcpPolicy, prio)
-				if err != nil {
-					log.WithFields(log.Fields{
-						"timestamp":     time.Now(),
-						"unixtimestamp": time.Now().UnixNano(),
-						"project":       gcpProject,
-					}).Errorf("Failed to remove a rule from the policy: %v", err)
-					exitCode = 1
-					return
-				}
+					"project":       group.Project,
+				}).Errorf("Failed to apply the %s policy diff plan: %v", family.name, err)
+				return err
 			}
-			// move the left index pointer 10 positions to the right
-			l = +10
+			metrics.RulesAdded.WithLabelValues(target.RuleDescription).Add(float64(len(plan.ToAdd)))
+			metrics.RulesPatched.WithLabelValues(target.RuleDescription).Add(float64(len(plan.ToPatch)))
+			metrics.RulesRemoved.WithLabelValues(target.RuleDescription).Add(float64(len(plan.ToRemove)))
 		}
 	}
 
+	if len(mutating) == 0 {
+		log.WithFields(log.Fields{
+			"timestamp":     time.Now(),
+			"unixtimestamp": time.Now().UnixNano(),
+			"project":       group.Project,
+		}).Info("Stopping flaresync (dry run only, policy left untouched)")
+		return nil
+	}
+
 	// get the current policy's eTag after all operations
-	policy, err = gcp.GetCloudArmorPolicy(ctx, client, gcpProject, gcpPolicy)
+	policy, err = gcp.GetCloudArmorPolicy(ctx, client, group.Project, group.Policy)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"timestamp":     time.Now(),
 			"unixtimestamp": time.Now().UnixNano(),
-			"project":       gcpProject,
+			"project":       group.Project,
 		}).Errorf("Failed to get the security policy state: %v", err)
-		exitCode = 1
-		return
+		return err
 	}
-	ca_etag = policy.GetFingerprint()
+	ca_etag := policy.GetFingerprint()
 
-	// update the policy with a new CloudFlare eTag (i.e. the policy Description)
+	// update the policy with the new combined ETag (i.e. the policy Description)
 	policy = &computepb.SecurityPolicy{
-		Description: &cf_etag,
+		Description: &combinedEtag,
 		Fingerprint: &ca_etag,
 	}
 	log.WithFields(log.Fields{
 		"timestamp":     time.Now(),
 		"unixtimestamp": time.Now().UnixNano(),
-		"project":       gcpProject,
-	}).Infof("Updating the policy description with ETag %v", cf_etag)
-	err = gcp.PatchCloudArmorPolicy(ctx, client, gcpProject, gcpPolicy, policy)
-	if err != nil {
+		"project":       group.Project,
+	}).Infof("Updating the policy description with ETag %v", combinedEtag)
+	if err := gcp.PatchCloudArmorPolicy(ctx, client, group.Project, group.Policy, policy); err != nil {
 		log.WithFields(log.Fields{
 			"timestamp":     time.Now(),
 			"unixtimestamp": time.Now().UnixNano(),
-			"project":       gcpProject,
+			"project":       group.Project,
 		}).Errorf("Failed to patch the security policy: %v", err)
-		exitCode = 1
-		return
+		return err
+	}
+
+	// CurrentSourceEtag is reset once per full reconciliation pass (in main
+	// and runDaemon's tick), not here, since a -config run calls
+	// runSyncForPolicy once per policy group and resetting per-group would
+	// wipe out every previously processed group's gauges.
+	for _, r := range mutating {
+		metrics.CurrentSourceEtag.WithLabelValues(r.target.RuleDescription, r.etag).Set(1)
 	}
 
 	// exit the app
 	log.WithFields(log.Fields{
 		"timestamp":     time.Now(),
 		"unixtimestamp": time.Now().UnixNano(),
-		"project":       gcpProject,
+		"project":       group.Project,
 	}).Info("Stopping flaresync")
+	return nil
 }
@@ -0,0 +1,312 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	computepb "cloud.google.com/go/compute/apiv1/computepb"
+)
+
+// PlanOptions carries the rule defaults used when building new or patched
+// SecurityPolicyRules for a given CIDR family/namespace, plus the
+// inclusive priority window PlanPolicyDiff is confined to: only existing
+// rules whose priority falls in [PriorityStart, PriorityEnd] are
+// considered for patch/remove, and new rules are only ever assigned
+// priorities within that range.
+type PlanOptions struct {
+	RuleDescription string
+	Action          string
+	VersionedExpr   string
+	PriorityStart   int32
+	PriorityEnd     int32
+}
+
+// RulesNeeded returns how many 10-CIDR Cloud Armor rules are required to
+// hold count CIDRs.
+func RulesNeeded(count int) int {
+	return (count + 9) / 10
+}
+
+// Window is an inclusive range of rule priorities a reconciler is allowed
+// to touch.
+type Window struct {
+	Start int32
+	End   int32
+}
+
+// Size returns the number of priority slots in w.
+func (w Window) Size() int32 {
+	if w.End < w.Start {
+		return 0
+	}
+	return w.End - w.Start + 1
+}
+
+// Split divides w into two contiguous sub-windows, v4Window followed by
+// v6Window, sized to hold v4Count and v6Count CIDRs respectively. It
+// fails fast if w does not have enough priority slots for the combined
+// requirement (ceil(count/10) rules per family), so a misconfigured
+// -config priority range is caught before any of that target's rules are
+// added, patched or removed.
+func (w Window) Split(v4Count, v6Count int) (v4Window, v6Window Window, err error) {
+	v4Needed := int32(RulesNeeded(v4Count))
+	v6Needed := int32(RulesNeeded(v6Count))
+	if v4Needed+v6Needed > w.Size() {
+		return Window{}, Window{}, fmt.Errorf(
+			"priority window [%d,%d] (%d slots) is too small for %d CIDRs (needs %d rules of up to 10 CIDRs each)",
+			w.Start, w.End, w.Size(), v4Count+v6Count, v4Needed+v6Needed,
+		)
+	}
+	v4Window = Window{Start: w.Start, End: w.Start + v4Needed - 1}
+	v6Window = Window{Start: v4Window.End + 1, End: w.End}
+	return v4Window, v6Window, nil
+}
+
+// existingPriorities returns the sorted priorities of the rules in policy
+// whose Description is ruleDescription and whose priority falls inside w.
+func existingPriorities(policy *computepb.SecurityPolicy, ruleDescription string, w Window) []int32 {
+	var priorities []int32
+	for _, rule := range policy.GetRules() {
+		if rule.GetDescription() != ruleDescription {
+			continue
+		}
+		if rule.GetPriority() < w.Start || rule.GetPriority() > w.End {
+			continue
+		}
+		priorities = append(priorities, rule.GetPriority())
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] < priorities[j] })
+	return priorities
+}
+
+// SplitStable divides w into v4Window and v6Window like Split does, except
+// that once rules matching v4Desc and/or v6Desc already exist in
+// currentPolicy within w, the boundary between them is pinned to where
+// those rules actually live rather than recomputed from v4Count/v6Count.
+// Without this, a CIDR-count change in one family that crosses a 10-per-rule
+// boundary on a later pass would shift the other family's already-deployed
+// rules to a different (and possibly occupied) split point, orphaning them.
+// Growing a family past its pinned boundary fails fast with a "window too
+// small" error, as Split does, rather than encroaching on the other
+// family's rules.
+func (w Window) SplitStable(currentPolicy *computepb.SecurityPolicy, v4Desc, v6Desc string, v4Count, v6Count int) (v4Window, v6Window Window, err error) {
+	v4Existing := existingPriorities(currentPolicy, v4Desc, w)
+	v6Existing := existingPriorities(currentPolicy, v6Desc, w)
+
+	if len(v4Existing) == 0 && len(v6Existing) == 0 {
+		return w.Split(v4Count, v6Count)
+	}
+
+	switch {
+	case len(v4Existing) > 0 && len(v6Existing) > 0:
+		v4Window = Window{Start: w.Start, End: v4Existing[len(v4Existing)-1]}
+		v6Window = Window{Start: v6Existing[0], End: w.End}
+		if v6Window.Start <= v4Window.End {
+			return Window{}, Window{}, fmt.Errorf("existing v4 and v6 rules overlap in priority window [%d,%d]", w.Start, w.End)
+		}
+	case len(v4Existing) > 0:
+		v4Window = Window{Start: w.Start, End: v4Existing[len(v4Existing)-1]}
+		v6Window = Window{Start: v4Window.End + 1, End: w.End}
+	default:
+		v6Window = Window{Start: v6Existing[0], End: w.End}
+		v4Window = Window{Start: w.Start, End: v6Window.Start - 1}
+	}
+
+	if needed := int32(RulesNeeded(v4Count)); needed > v4Window.Size() {
+		return Window{}, Window{}, fmt.Errorf(
+			"priority window [%d,%d] (%d slots) is too small for %d v4 CIDRs (needs %d rules); the v4/v6 boundary is pinned to the existing rules and won't move automatically",
+			v4Window.Start, v4Window.End, v4Window.Size(), v4Count, needed,
+		)
+	}
+	if needed := int32(RulesNeeded(v6Count)); needed > v6Window.Size() {
+		return Window{}, Window{}, fmt.Errorf(
+			"priority window [%d,%d] (%d slots) is too small for %d v6 CIDRs (needs %d rules); the v4/v6 boundary is pinned to the existing rules and won't move automatically",
+			v6Window.Start, v6Window.End, v6Window.Size(), v6Count, needed,
+		)
+	}
+	return v4Window, v6Window, nil
+}
+
+// Plan is the set of GCP Cloud Armor operations needed to make a policy's
+// rules (identified by PlanOptions.RuleDescription) match a desired CIDR
+// list. It is computed by PlanPolicyDiff and executed by ApplyPlan.
+type Plan struct {
+	ToAdd    []*computepb.SecurityPolicyRule
+	ToPatch  []*computepb.SecurityPolicyRule
+	ToRemove []int32
+}
+
+// canonicalizeCIDR parses cidr and returns its canonical network form (e.g.
+// "1.2.3.4/24" becomes "1.2.3.0/24"), so two CIDR lists that describe the
+// same set of addresses compare equal regardless of how they were written
+// or ordered.
+func canonicalizeCIDR(cidr string) (string, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	return ipnet.String(), nil
+}
+
+// canonicalSortedSet canonicalizes every CIDR in cidrs and returns them
+// sorted, so the result only depends on the effective set of addresses.
+func canonicalSortedSet(cidrs []string) ([]string, error) {
+	out := make([]string, 0, len(cidrs))
+	for _, c := range cidrs {
+		canon, err := canonicalizeCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, canon)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func equalStringSlices(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// PlanPolicyDiff computes a Plan that reconciles the rules in currentPolicy
+// matching opts.RuleDescription against desiredCIDRs. The existing
+// SrcIpRanges are flattened across those rules (in priority order) and
+// compared to desiredCIDRs as canonicalized, sorted CIDR sets, so reordering
+// or re-casing CIDRs on either side does not trigger a patch. The existing
+// rules' Action and VersionedExpr are also compared against opts, so an
+// operator changing only a target's action (e.g. allow to deny in -config)
+// still produces a plan even when the CIDR set is unchanged. When the
+// effective sets or action/VersionedExpr differ, rules are rebuilt in chunks
+// of 10 CIDRs (the Cloud Armor per-rule limit): existing priorities are
+// reused for ToPatch, new priorities are allocated for ToAdd, and any
+// priorities left over from the old rule count are returned in ToRemove.
+func PlanPolicyDiff(currentPolicy *computepb.SecurityPolicy, desiredCIDRs []string, opts PlanOptions) (*Plan, error) {
+	window := Window{Start: opts.PriorityStart, End: opts.PriorityEnd}
+	if window.Size() <= 0 {
+		return nil, fmt.Errorf("invalid priority window [%d,%d]", opts.PriorityStart, opts.PriorityEnd)
+	}
+
+	type existingRule struct {
+		priority      int32
+		ranges        []string
+		action        string
+		versionedExpr string
+	}
+	var existing []existingRule
+	for _, rule := range currentPolicy.GetRules() {
+		if rule.GetDescription() != opts.RuleDescription {
+			continue
+		}
+		if rule.GetPriority() < window.Start || rule.GetPriority() > window.End {
+			continue
+		}
+		existing = append(existing, existingRule{
+			priority:      rule.GetPriority(),
+			ranges:        rule.GetMatch().GetConfig().GetSrcIpRanges(),
+			action:        rule.GetAction(),
+			versionedExpr: rule.GetMatch().GetVersionedExpr(),
+		})
+	}
+	sort.Slice(existing, func(i, j int) bool { return existing[i].priority < existing[j].priority })
+
+	existingPriorities := make([]int32, len(existing))
+	var existingFlattened []string
+	actionsMatch := true
+	for i, r := range existing {
+		existingPriorities[i] = r.priority
+		existingFlattened = append(existingFlattened, r.ranges...)
+		if r.action != opts.Action || r.versionedExpr != opts.VersionedExpr {
+			actionsMatch = false
+		}
+	}
+
+	currentSet, err := canonicalSortedSet(existingFlattened)
+	if err != nil {
+		return nil, err
+	}
+	desiredSet, err := canonicalSortedSet(desiredCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	if equalStringSlices(currentSet, desiredSet) && actionsMatch {
+		return plan, nil
+	}
+
+	const rulesPerChunk = 10
+	chunksNeeded := RulesNeeded(len(desiredSet))
+	if int32(chunksNeeded) > window.Size() {
+		return nil, fmt.Errorf(
+			"priority window [%d,%d] (%d slots) is too small for %d CIDRs (needs %d rules)",
+			window.Start, window.End, window.Size(), len(desiredSet), chunksNeeded,
+		)
+	}
+
+	for i := 0; i < chunksNeeded; i++ {
+		l := i * rulesPerChunk
+		r := l + rulesPerChunk
+		if r > len(desiredSet) {
+			r = len(desiredSet)
+		}
+		var priority int32
+		if i < len(existingPriorities) {
+			priority = existingPriorities[i]
+		} else {
+			priority = window.Start + int32(i)
+		}
+		rule := &computepb.SecurityPolicyRule{
+			Description: &opts.RuleDescription,
+			Action:      &opts.Action,
+			Priority:    &priority,
+			Match: &computepb.SecurityPolicyRuleMatcher{
+				VersionedExpr: &opts.VersionedExpr,
+				Config: &computepb.SecurityPolicyRuleMatcherConfig{
+					SrcIpRanges: desiredSet[l:r],
+				},
+			},
+		}
+		if i < len(existingPriorities) {
+			plan.ToPatch = append(plan.ToPatch, rule)
+		} else {
+			plan.ToAdd = append(plan.ToAdd, rule)
+		}
+	}
+
+	for i := chunksNeeded; i < len(existingPriorities); i++ {
+		plan.ToRemove = append(plan.ToRemove, existingPriorities[i])
+	}
+
+	return plan, nil
+}
+
+// ApplyPlan executes a Plan against the given Cloud Armor policy, adding,
+// patching and removing rules as computed by PlanPolicyDiff.
+func ApplyPlan(ctx context.Context, client *compute.SecurityPoliciesClient, projectID, policyName string, plan *Plan) error {
+	for _, rule := range plan.ToAdd {
+		if err := AddCloudArmorRule(ctx, client, projectID, policyName, rule); err != nil {
+			return err
+		}
+	}
+	for _, rule := range plan.ToPatch {
+		if err := PatchCloudArmorRule(ctx, client, projectID, policyName, rule.GetPriority(), rule); err != nil {
+			return err
+		}
+	}
+	for _, priority := range plan.ToRemove {
+		if err := RemoveCloudArmorRule(ctx, client, projectID, policyName, priority); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package gcp
+
+import (
+	"testing"
+
+	computepb "cloud.google.com/go/compute/apiv1/computepb"
+)
+
+func TestWindowSplit(t *testing.T) {
+	w := Window{Start: 1000, End: 1019}
+	v4, v6, err := w.Split(15, 5)
+	if err != nil {
+		t.Fatalf("Split returned an error: %v", err)
+	}
+	if v4 != (Window{Start: 1000, End: 1001}) {
+		t.Errorf("v4 window = %+v, want {1000 1001}", v4)
+	}
+	if v6 != (Window{Start: 1002, End: 1019}) {
+		t.Errorf("v6 window = %+v, want {1002 1019}", v6)
+	}
+}
+
+func TestWindowSplitTooSmall(t *testing.T) {
+	w := Window{Start: 1000, End: 1000}
+	if _, _, err := w.Split(11, 0); err == nil {
+		t.Fatal("expected an error for a window too small for 11 CIDRs, got nil")
+	}
+}
+
+func TestWindowSplitStablePinsBoundaryAcrossPasses(t *testing.T) {
+	window := Window{Start: 1000, End: 1019}
+	v4Desc, v6Desc := "cloudflare-v4 - dont change", "cloudflare-v6 - dont change"
+
+	// Pass 1: v4=9 CIDRs fits in one rule at 1000, and the v6 rules start
+	// right after it at 1001 (only that first v6 rule is modelled here).
+	policy := &computepb.SecurityPolicy{
+		Rules: []*computepb.SecurityPolicyRule{
+			newRule(1000, v4Desc, "allow", "SRC_IPS_V1", make([]string, 9)),
+			newRule(1001, v6Desc, "allow", "SRC_IPS_V1", make([]string, 10)),
+		},
+	}
+
+	// Pass 2: v4 grows to 15 CIDRs (two rules). Recomputing the split from
+	// scratch would move the v4/v6 boundary to 1002, orphaning the
+	// existing v6 rule at 1001. SplitStable must instead keep the v6 rule's
+	// priority fixed and reject the v4 growth as not fitting its pinned
+	// single-rule window.
+	_, _, err := window.SplitStable(policy, v4Desc, v6Desc, 15, 90)
+	if err == nil {
+		t.Fatal("expected an error when v4 growth would cross the pinned v4/v6 boundary, got nil")
+	}
+
+	// Growth that still fits within the pinned v4 window succeeds and
+	// leaves the boundary exactly where the existing rules put it.
+	v4Window, v6Window, err := window.SplitStable(policy, v4Desc, v6Desc, 10, 90)
+	if err != nil {
+		t.Fatalf("SplitStable returned an error: %v", err)
+	}
+	if v4Window != (Window{Start: 1000, End: 1000}) {
+		t.Errorf("v4 window = %+v, want {1000 1000} (pinned to the existing rule)", v4Window)
+	}
+	if v6Window != (Window{Start: 1001, End: 1019}) {
+		t.Errorf("v6 window = %+v, want {1001 1019} (pinned to the existing rule)", v6Window)
+	}
+}
+
+func TestWindowSplitStableFallsBackToSplitWhenNoRulesExist(t *testing.T) {
+	window := Window{Start: 1000, End: 1019}
+	policy := &computepb.SecurityPolicy{}
+
+	v4Window, v6Window, err := window.SplitStable(policy, "cloudflare-v4 - dont change", "cloudflare-v6 - dont change", 15, 5)
+	if err != nil {
+		t.Fatalf("SplitStable returned an error: %v", err)
+	}
+	if v4Window != (Window{Start: 1000, End: 1001}) {
+		t.Errorf("v4 window = %+v, want {1000 1001}", v4Window)
+	}
+	if v6Window != (Window{Start: 1002, End: 1019}) {
+		t.Errorf("v6 window = %+v, want {1002 1019}", v6Window)
+	}
+}
+
+func newRule(priority int32, description, action, versionedExpr string, srcIPRanges []string) *computepb.SecurityPolicyRule {
+	return &computepb.SecurityPolicyRule{
+		Description: &description,
+		Action:      &action,
+		Priority:    &priority,
+		Match: &computepb.SecurityPolicyRuleMatcher{
+			VersionedExpr: &versionedExpr,
+			Config: &computepb.SecurityPolicyRuleMatcherConfig{
+				SrcIpRanges: srcIPRanges,
+			},
+		},
+	}
+}
+
+func TestPlanPolicyDiffNoExistingRules(t *testing.T) {
+	policy := &computepb.SecurityPolicy{}
+	opts := PlanOptions{RuleDescription: "cloudflare-v4 - dont change", Action: "allow", VersionedExpr: "SRC_IPS_V1", PriorityStart: 1000, PriorityEnd: 1010}
+
+	plan, err := PlanPolicyDiff(policy, []string{"1.2.3.0/24", "4.5.6.0/24"}, opts)
+	if err != nil {
+		t.Fatalf("PlanPolicyDiff returned an error: %v", err)
+	}
+	if len(plan.ToAdd) != 1 || len(plan.ToPatch) != 0 || len(plan.ToRemove) != 0 {
+		t.Fatalf("plan = %+v, want a single ToAdd rule", plan)
+	}
+	if got := plan.ToAdd[0].GetPriority(); got != 1000 {
+		t.Errorf("new rule priority = %d, want 1000", got)
+	}
+}
+
+func TestPlanPolicyDiffUnchangedSetIsEmptyPlan(t *testing.T) {
+	policy := &computepb.SecurityPolicy{
+		Rules: []*computepb.SecurityPolicyRule{
+			newRule(1000, "cloudflare-v4 - dont change", "allow", "SRC_IPS_V1", []string{"1.2.3.0/24"}),
+		},
+	}
+	opts := PlanOptions{RuleDescription: "cloudflare-v4 - dont change", Action: "allow", VersionedExpr: "SRC_IPS_V1", PriorityStart: 1000, PriorityEnd: 1010}
+
+	// Writing the same network with host bits set should not trigger a patch.
+	plan, err := PlanPolicyDiff(policy, []string{"1.2.3.4/24"}, opts)
+	if err != nil {
+		t.Fatalf("PlanPolicyDiff returned an error: %v", err)
+	}
+	if len(plan.ToAdd)+len(plan.ToPatch)+len(plan.ToRemove) != 0 {
+		t.Fatalf("plan = %+v, want an empty plan for an unchanged CIDR set", plan)
+	}
+}
+
+func TestPlanPolicyDiffActionOnlyChangeStillPatches(t *testing.T) {
+	policy := &computepb.SecurityPolicy{
+		Rules: []*computepb.SecurityPolicyRule{
+			newRule(1000, "cloudflare-v4 - dont change", "allow", "SRC_IPS_V1", []string{"1.2.3.0/24"}),
+		},
+	}
+	// Same CIDR set, but the operator changed the target's action to deny.
+	opts := PlanOptions{RuleDescription: "cloudflare-v4 - dont change", Action: "deny(403)", VersionedExpr: "SRC_IPS_V1", PriorityStart: 1000, PriorityEnd: 1010}
+
+	plan, err := PlanPolicyDiff(policy, []string{"1.2.3.0/24"}, opts)
+	if err != nil {
+		t.Fatalf("PlanPolicyDiff returned an error: %v", err)
+	}
+	if len(plan.ToPatch) != 1 {
+		t.Fatalf("plan = %+v, want a single ToPatch rule when only the action changed", plan)
+	}
+	if got := plan.ToPatch[0].GetAction(); got != "deny(403)" {
+		t.Errorf("patched rule action = %q, want %q", got, "deny(403)")
+	}
+}
+
+func TestPlanPolicyDiffShrinkingSetRemovesExcessRules(t *testing.T) {
+	policy := &computepb.SecurityPolicy{
+		Rules: []*computepb.SecurityPolicyRule{
+			newRule(1000, "cloudflare-v4 - dont change", "allow", "SRC_IPS_V1", []string{"1.1.1.0/24", "1.1.2.0/24"}),
+			newRule(1001, "cloudflare-v4 - dont change", "allow", "SRC_IPS_V1", []string{"1.1.3.0/24"}),
+		},
+	}
+	opts := PlanOptions{RuleDescription: "cloudflare-v4 - dont change", Action: "allow", VersionedExpr: "SRC_IPS_V1", PriorityStart: 1000, PriorityEnd: 1010}
+
+	plan, err := PlanPolicyDiff(policy, []string{"1.1.1.0/24"}, opts)
+	if err != nil {
+		t.Fatalf("PlanPolicyDiff returned an error: %v", err)
+	}
+	if len(plan.ToPatch) != 1 || plan.ToPatch[0].GetPriority() != 1000 {
+		t.Fatalf("plan.ToPatch = %+v, want the rule at priority 1000 patched", plan.ToPatch)
+	}
+	if len(plan.ToRemove) != 1 || plan.ToRemove[0] != 1001 {
+		t.Fatalf("plan.ToRemove = %v, want [1001]", plan.ToRemove)
+	}
+}
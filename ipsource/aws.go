@@ -0,0 +1,94 @@
+package ipsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const awsURL = "https://ip-ranges.amazonaws.com/ip-ranges.json"
+
+type awsIPv4Prefix struct {
+	IPPrefix string `json:"ip_prefix"`
+	Region   string `json:"region"`
+	Service  string `json:"service"`
+}
+
+type awsIPv6Prefix struct {
+	IPv6Prefix string `json:"ipv6_prefix"`
+	Region     string `json:"region"`
+	Service    string `json:"service"`
+}
+
+type awsIPRanges struct {
+	SyncToken    string          `json:"syncToken"`
+	Prefixes     []awsIPv4Prefix `json:"prefixes"`
+	IPv6Prefixes []awsIPv6Prefix `json:"ipv6_prefixes"`
+}
+
+// AWSProvider fetches AWS's published IP ranges, optionally filtered to a
+// specific Service (e.g. "CLOUDFRONT") and/or Region (e.g. "us-east-1").
+// An empty Service or Region matches every prefix. AWS's own syncToken is
+// used as the ETag.
+type AWSProvider struct {
+	Service string
+	Region  string
+}
+
+func NewAWSProvider(service, region string) *AWSProvider {
+	return &AWSProvider{Service: service, Region: region}
+}
+
+func (p *AWSProvider) Name() string { return "aws" }
+
+func (p *AWSProvider) Fetch(ctx context.Context) (string, []string, []string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, awsURL, nil)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var ranges awsIPRanges
+	if err := json.Unmarshal(body, &ranges); err != nil {
+		return "", nil, nil, err
+	}
+
+	var v4, v6 []string
+	for _, prefix := range ranges.Prefixes {
+		if p.matches(prefix.Service, prefix.Region) {
+			v4 = append(v4, prefix.IPPrefix)
+		}
+	}
+	for _, prefix := range ranges.IPv6Prefixes {
+		if p.matches(prefix.Service, prefix.Region) {
+			v6 = append(v6, prefix.IPv6Prefix)
+		}
+	}
+
+	if len(v4) == 0 && len(v6) == 0 {
+		return "", nil, nil, fmt.Errorf("no AWS IP ranges matched service=%q region=%q", p.Service, p.Region)
+	}
+
+	return ranges.SyncToken, v4, v6, nil
+}
+
+func (p *AWSProvider) matches(service, region string) bool {
+	if p.Service != "" && p.Service != service {
+		return false
+	}
+	if p.Region != "" && p.Region != region {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package ipsource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+type cloudflareResult struct {
+	IPv4CIDRs []string `json:"ipv4_cidrs"`
+	IPv6CIDRs []string `json:"ipv6_cidrs"`
+	ETag      string   `json:"etag"`
+}
+
+type cloudflareResponse struct {
+	Result   cloudflareResult `json:"result"`
+	Success  bool             `json:"success"`
+	Errors   []interface{}
+	Messages []interface{}
+}
+
+const cloudflareURL = "https://api.cloudflare.com/client/v4/ips"
+
+// CloudflareProvider fetches CloudFlare's published IP ranges from the
+// public /client/v4/ips endpoint.
+type CloudflareProvider struct{}
+
+func NewCloudflareProvider() *CloudflareProvider {
+	return &CloudflareProvider{}
+}
+
+func (p *CloudflareProvider) Name() string { return "cloudflare" }
+
+func (p *CloudflareProvider) Fetch(ctx context.Context) (string, []string, []string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cloudflareURL, nil)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var response cloudflareResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", nil, nil, err
+	}
+
+	if response.Result.ETag == "" {
+		return "", nil, nil, errors.New("CloudFlare returned an empty ETag")
+	} else if len(response.Result.IPv4CIDRs) == 0 {
+		return "", nil, nil, errors.New("CloudFlare returned an empty IP ranges list")
+	}
+
+	return response.Result.ETag, response.Result.IPv4CIDRs, response.Result.IPv6CIDRs, nil
+}
@@ -0,0 +1,53 @@
+package ipsource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+const fastlyURL = "https://api.fastly.com/public-ip-list"
+
+type fastlyResponse struct {
+	Addresses     []string `json:"addresses"`
+	IPv6Addresses []string `json:"ipv6_addresses"`
+}
+
+// FastlyProvider fetches Fastly's published IP ranges. Fastly's endpoint
+// has no version token, so the SHA-256 hash of the response body is used
+// as the ETag.
+type FastlyProvider struct{}
+
+func NewFastlyProvider() *FastlyProvider { return &FastlyProvider{} }
+
+func (p *FastlyProvider) Name() string { return "fastly" }
+
+func (p *FastlyProvider) Fetch(ctx context.Context) (string, []string, []string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fastlyURL, nil)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var response fastlyResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", nil, nil, err
+	}
+
+	if len(response.Addresses) == 0 && len(response.IPv6Addresses) == 0 {
+		return "", nil, nil, errors.New("Fastly returned an empty IP ranges list")
+	}
+
+	return hashEtag(body), response.Addresses, response.IPv6Addresses, nil
+}
@@ -0,0 +1,47 @@
+package ipsource
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+// FileProvider reads CIDRs from a local file, one per line. A line reading
+// "# ipv6" (case-insensitive) switches subsequent lines into the IPv6 list; every
+// line before it is treated as IPv4. Blank lines and other lines starting
+// with "#" are ignored. This is the simplest provider, useful for static
+// allow-lists or CIDRs staged out-of-band.
+type FileProvider struct {
+	Path string
+}
+
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{Path: path}
+}
+
+func (p *FileProvider) Name() string { return "file" }
+
+func (p *FileProvider) Fetch(ctx context.Context) (string, []string, []string, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var v4, v6 []string
+	dest := &v4
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if strings.EqualFold(line, "# ipv6") {
+				dest = &v6
+			}
+			continue
+		}
+		*dest = append(*dest, line)
+	}
+
+	return hashEtag(data), v4, v6, nil
+}
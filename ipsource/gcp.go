@@ -0,0 +1,83 @@
+package ipsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultGCPRangesURL is Google's published list of its own IP ranges.
+// GoogGCPRangesURL covers the broader set of ranges Google owns or
+// advertises (goog.json), which callers can pass instead when they need
+// more than strictly Google Cloud ranges.
+const (
+	DefaultGCPRangesURL = "https://www.gstatic.com/ipranges/cloud.json"
+	GoogGCPRangesURL    = "https://www.gstatic.com/ipranges/goog.json"
+)
+
+type gcpPrefix struct {
+	IPv4Prefix string `json:"ipv4Prefix"`
+	IPv6Prefix string `json:"ipv6Prefix"`
+	Service    string `json:"service"`
+	Scope      string `json:"scope"`
+}
+
+type gcpRanges struct {
+	SyncToken string      `json:"syncToken"`
+	Prefixes  []gcpPrefix `json:"prefixes"`
+}
+
+// GCPProvider fetches Google's published IP ranges from cloud.json (or
+// goog.json, via URL). Google's own syncToken is used as the ETag.
+type GCPProvider struct {
+	URL string
+}
+
+func NewGCPProvider(url string) *GCPProvider {
+	if url == "" {
+		url = DefaultGCPRangesURL
+	}
+	return &GCPProvider{URL: url}
+}
+
+func (p *GCPProvider) Name() string { return "gcp" }
+
+func (p *GCPProvider) Fetch(ctx context.Context) (string, []string, []string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var ranges gcpRanges
+	if err := json.Unmarshal(body, &ranges); err != nil {
+		return "", nil, nil, err
+	}
+
+	var v4, v6 []string
+	for _, prefix := range ranges.Prefixes {
+		if prefix.IPv4Prefix != "" {
+			v4 = append(v4, prefix.IPv4Prefix)
+		}
+		if prefix.IPv6Prefix != "" {
+			v6 = append(v6, prefix.IPv6Prefix)
+		}
+	}
+
+	if len(v4) == 0 && len(v6) == 0 {
+		return "", nil, nil, fmt.Errorf("no IP ranges found at %s", p.URL)
+	}
+
+	return ranges.SyncToken, v4, v6, nil
+}
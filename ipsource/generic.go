@@ -0,0 +1,147 @@
+package ipsource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GenericProvider fetches CIDRs from an arbitrary HTTP endpoint. When
+// V4Path/V6Path are empty, the response body is treated as plain text with
+// one CIDR per line (used for V4Path) and no IPv6 ranges. Otherwise the
+// body is parsed as JSON and V4Path/V6Path select the CIDRs within it,
+// using a dotted path where a "[]" segment flattens through a JSON array
+// (e.g. "prefixes.[].ip_prefix"). ETagPath works the same way and, if
+// unset or unresolvable, falls back to the SHA-256 hash of the body so
+// callers can still detect changes.
+type GenericProvider struct {
+	URL      string
+	V4Path   string
+	V6Path   string
+	ETagPath string
+}
+
+func NewGenericProvider(url, v4Path, v6Path, etagPath string) *GenericProvider {
+	return &GenericProvider{URL: url, V4Path: v4Path, V6Path: v6Path, ETagPath: etagPath}
+}
+
+func (p *GenericProvider) Name() string { return "url:" + p.URL }
+
+func (p *GenericProvider) Fetch(ctx context.Context) (string, []string, []string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if p.V4Path == "" && p.V6Path == "" {
+		v4 := splitLines(body)
+		if len(v4) == 0 {
+			return "", nil, nil, fmt.Errorf("no CIDRs found in plain-text response from %s", p.URL)
+		}
+		return hashEtag(body), v4, nil, nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", nil, nil, fmt.Errorf("parsing JSON from %s: %w", p.URL, err)
+	}
+
+	var v4, v6 []string
+	if p.V4Path != "" {
+		if v4, err = extractStrings(doc, p.V4Path); err != nil {
+			return "", nil, nil, err
+		}
+	}
+	if p.V6Path != "" {
+		if v6, err = extractStrings(doc, p.V6Path); err != nil {
+			return "", nil, nil, err
+		}
+	}
+	if len(v4) == 0 && len(v6) == 0 {
+		return "", nil, nil, fmt.Errorf("no CIDRs extracted from %s", p.URL)
+	}
+
+	etag := hashEtag(body)
+	if p.ETagPath != "" {
+		if vals, err := extractStrings(doc, p.ETagPath); err == nil && len(vals) > 0 {
+			etag = vals[0]
+		}
+	}
+
+	return etag, v4, v6, nil
+}
+
+func hashEtag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func splitLines(body []byte) []string {
+	var out []string
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// extractStrings walks doc along a dotted path (e.g. "prefixes.[].ip_prefix")
+// and collects every string value reached, flattening through a JSON array
+// wherever a "[]" segment appears.
+func extractStrings(doc interface{}, path string) ([]string, error) {
+	return walkPath(doc, strings.Split(path, "."), path)
+}
+
+func walkPath(node interface{}, segments []string, path string) ([]string, error) {
+	if len(segments) == 0 {
+		s, ok := node.(string)
+		if !ok {
+			return nil, fmt.Errorf("path %q did not resolve to a string", path)
+		}
+		return []string{s}, nil
+	}
+
+	seg := segments[0]
+	if seg == "[]" {
+		arr, ok := node.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("path %q expected an array", path)
+		}
+		var out []string
+		for _, el := range arr {
+			vals, err := walkPath(el, segments[1:], path)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, vals...)
+		}
+		return out, nil
+	}
+
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("path %q expected an object at %q", path, seg)
+	}
+	child, ok := m[seg]
+	if !ok {
+		return nil, fmt.Errorf("path %q: key %q not found", path, seg)
+	}
+	return walkPath(child, segments[1:], path)
+}
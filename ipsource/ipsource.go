@@ -0,0 +1,19 @@
+// Package ipsource defines a common interface for fetching published IP
+// range feeds (CloudFlare, AWS, GCP, Fastly, or an arbitrary HTTP/file
+// source) so flaresync can reconcile a Cloud Armor policy against any
+// combination of them.
+package ipsource
+
+import "context"
+
+// Provider fetches a snapshot of CIDR ranges from an upstream IP-range
+// feed. Fetch returns an etag identifying the snapshot (so callers can
+// skip reconciliation when nothing changed) along with the IPv4 and IPv6
+// CIDR lists.
+type Provider interface {
+	// Name identifies the provider, used to namespace the Cloud Armor
+	// rule descriptions it owns so multiple providers can reconcile the
+	// same policy without clobbering each other's rules.
+	Name() string
+	Fetch(ctx context.Context) (etag string, v4, v6 []string, err error)
+}
@@ -0,0 +1,105 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// lease is the content of the GCS lease object: whoever holds a
+// non-expired lease is the leader.
+type lease struct {
+	HolderID  string    `json:"holderId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// GCSElector implements Elector using a single GCS object as a lease.
+// Acquisition is guarded by the object's generation precondition, so
+// concurrent instances racing to write the same lease period can only
+// have one writer win.
+type GCSElector struct {
+	client   *storage.Client
+	bucket   string
+	object   string
+	holderID string
+	ttl      time.Duration
+}
+
+// NewGCSElector returns an Elector backed by gs://bucket/object. holderID
+// should be unique per running instance (e.g. hostname+pid) and ttl is how
+// long a lease is valid before another instance may take over.
+func NewGCSElector(client *storage.Client, bucket, object, holderID string, ttl time.Duration) *GCSElector {
+	return &GCSElector{client: client, bucket: bucket, object: object, holderID: holderID, ttl: ttl}
+}
+
+func (e *GCSElector) Campaign(ctx context.Context) (bool, error) {
+	obj := e.client.Bucket(e.bucket).Object(e.object)
+
+	r, err := obj.NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return e.acquire(ctx, obj, 0)
+	}
+	if err != nil {
+		return false, err
+	}
+	var current lease
+	// the generation of the lease that was actually read, so the write
+	// below fails if anyone replaced it since
+	generation := r.Attrs.Generation
+	decodeErr := json.NewDecoder(r).Decode(&current)
+	r.Close()
+	if decodeErr != nil {
+		return false, decodeErr
+	}
+
+	if current.HolderID == e.holderID || time.Now().After(current.ExpiresAt) {
+		return e.acquire(ctx, obj, generation)
+	}
+
+	// Another instance holds a live lease.
+	return false, nil
+}
+
+// acquire writes a fresh lease for e.holderID, conditioned on the object
+// still being at generation (a generation of 0 means the object must not
+// exist yet). If a competing instance wrote first, the
+// conditional write fails with a 412 Precondition Failed and acquire reports
+// that we did not win; any other error (outage, permission, network) is
+// propagated so it isn't mistaken for losing the race.
+func (e *GCSElector) acquire(ctx context.Context, obj *storage.ObjectHandle, generation int64) (bool, error) {
+	data, err := json.Marshal(lease{HolderID: e.holderID, ExpiresAt: time.Now().Add(e.ttl)})
+	if err != nil {
+		return false, err
+	}
+
+	conds := storage.Conditions{GenerationMatch: generation}
+	if generation == 0 {
+		conds = storage.Conditions{DoesNotExist: true}
+	}
+	w := obj.If(conds).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return false, err
+	}
+	if err := w.Close(); err != nil {
+		if isPreconditionFailed(err) {
+			// Lost the race for this lease period - not an error, just not the leader.
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// isPreconditionFailed reports whether err is the GCS API's response to a
+// conditional write whose precondition (GenerationMatch) no longer held,
+// i.e. a competing instance won the race rather than a genuine failure.
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
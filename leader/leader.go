@@ -0,0 +1,15 @@
+// Package leader provides leader election for flaresync instances running
+// as multiple replicas (e.g. in Kubernetes or as a Cloud Run job), so only
+// one instance mutates the Cloud Armor policy at a time while the others
+// keep polling and exporting metrics.
+package leader
+
+import "context"
+
+// Elector decides whether the calling instance currently holds leadership.
+// Campaign should be called once per reconciliation tick; it attempts to
+// acquire or renew the lease and reports whether the caller is the leader
+// for the current term.
+type Elector interface {
+	Campaign(ctx context.Context) (bool, error)
+}
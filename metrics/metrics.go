@@ -0,0 +1,40 @@
+// Package metrics defines the Prometheus instrumentation exposed by
+// flaresync's daemon mode on /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	SyncDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name: "flaresync_sync_duration_seconds",
+		Help: "Duration of a single reconciliation pass against the Cloud Armor policy.",
+	})
+
+	FetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flaresync_source_fetch_errors_total",
+		Help: "Number of errors encountered fetching IP ranges, labeled by source provider name.",
+	}, []string{"source"})
+
+	RulesAdded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flaresync_rules_added_total",
+		Help: "Number of Cloud Armor rules added, labeled by the target's rule description.",
+	}, []string{"source"})
+
+	RulesPatched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flaresync_rules_patched_total",
+		Help: "Number of Cloud Armor rules patched, labeled by the target's rule description.",
+	}, []string{"source"})
+
+	RulesRemoved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flaresync_rules_removed_total",
+		Help: "Number of Cloud Armor rules removed, labeled by the target's rule description.",
+	}, []string{"source"})
+
+	CurrentSourceEtag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flaresync_current_source_etag_info",
+		Help: "Set to 1 for the ETag last successfully synced for a source; labeled by source and etag.",
+	}, []string{"source", "etag"})
+)